@@ -0,0 +1,92 @@
+package nsqlookup
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// srvLookupper is the subset of *net.Resolver that DNSResolver depends on,
+// it exists so tests can substitute a fake implementation instead of
+// performing real DNS queries.
+type srvLookupper interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// DNSResolver is a Resolver implementation which discovers nsqlookupd
+// servers from a DNS SRV record. It is primarily meant to be pointed at the
+// DNS name of a headless Kubernetes service, which publishes one SRV record
+// per ready pod, but it works against any DNS server that answers SRV
+// queries.
+type DNSResolver struct {
+	// Name is the domain name to query, for example
+	// "_nsqlookup._tcp.nsq.default.svc.cluster.local". If Name already
+	// starts with an underscore it is assumed to be a fully qualified SRV
+	// name and is queried as-is, with Service and Proto ignored.
+	Name string
+
+	// Service is the name of the SRV service to look up, defaults to
+	// "nsqlookup". Ignored if Name is a fully qualified SRV name.
+	Service string
+
+	// Proto is the protocol of the SRV service, defaults to "tcp". Ignored
+	// if Name is a fully qualified SRV name.
+	Proto string
+
+	// Resolver is the DNS resolver used to perform the lookup. If nil,
+	// net.DefaultResolver is used instead. Set this to point at a custom
+	// DNS server (e.g. kube-dns/CoreDNS) instead of the system resolver.
+	Resolver *net.Resolver
+
+	lookup srvLookupper
+}
+
+// Resolve performs a DNS SRV lookup and returns the discovered addresses as
+// "host:port" strings, sorted by priority and then by weight.
+func (d *DNSResolver) Resolve(ctx context.Context) ([]string, error) {
+	lookup := d.lookup
+	if lookup == nil {
+		lookup = d.resolver()
+	}
+
+	service, proto, name := d.Service, d.Proto, d.Name
+
+	if strings.HasPrefix(name, "_") {
+		service, proto = "", ""
+	} else {
+		if len(service) == 0 {
+			service = "nsqlookup"
+		}
+		if len(proto) == 0 {
+			proto = "tcp"
+		}
+	}
+
+	_, records, err := lookup.LookupSRV(ctx, service, proto, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		return records[i].Weight > records[j].Weight
+	})
+
+	addrs := make([]string, len(records))
+	for i, record := range records {
+		addrs[i] = fmt.Sprintf("%s:%d", strings.TrimSuffix(record.Target, "."), record.Port)
+	}
+
+	return addrs, nil
+}
+
+func (d *DNSResolver) resolver() *net.Resolver {
+	if d.Resolver != nil {
+		return d.Resolver
+	}
+	return net.DefaultResolver
+}
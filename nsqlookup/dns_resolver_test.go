@@ -0,0 +1,59 @@
+package nsqlookup
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+type fakeSRVLookupper struct {
+	records []*net.SRV
+	err     error
+}
+
+func (f fakeSRVLookupper) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	return name, f.records, nil
+}
+
+func TestDNSResolverResolve(t *testing.T) {
+	rslv := &DNSResolver{
+		Name: "_nsqlookup._tcp.nsq.default.svc.cluster.local",
+		lookup: fakeSRVLookupper{
+			records: []*net.SRV{
+				{Target: "nsqlookupd-1.nsq.default.svc.cluster.local.", Port: 4161, Priority: 10, Weight: 1},
+				{Target: "nsqlookupd-0.nsq.default.svc.cluster.local.", Port: 4161, Priority: 0, Weight: 1},
+				{Target: "nsqlookupd-2.nsq.default.svc.cluster.local.", Port: 4161, Priority: 10, Weight: 5},
+			},
+		},
+	}
+
+	addrs, err := rslv.Resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"nsqlookupd-0.nsq.default.svc.cluster.local:4161",
+		"nsqlookupd-2.nsq.default.svc.cluster.local:4161",
+		"nsqlookupd-1.nsq.default.svc.cluster.local:4161",
+	}
+
+	if !reflect.DeepEqual(addrs, expect) {
+		t.Error(addrs)
+	}
+}
+
+func TestDNSResolverResolveError(t *testing.T) {
+	rslv := &DNSResolver{
+		Name:   "_nsqlookup._tcp.nsq.default.svc.cluster.local",
+		lookup: fakeSRVLookupper{err: &net.DNSError{Err: "no such host", Name: "nsq.default.svc.cluster.local"}},
+	}
+
+	if _, err := rslv.Resolve(context.Background()); err == nil {
+		t.Error("expected an error, got none")
+	}
+}
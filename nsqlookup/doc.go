@@ -0,0 +1,26 @@
+// Package nsqlookup provides Resolver implementations used to discover the
+// set of nsqlookupd (or other) servers a client should talk to, plus the
+// plumbing to build and combine them from configuration.
+//
+// Most programs build their resolver from one or more discovery URLs via
+// ResolverFromURL and MultiResolverFromURLs rather than constructing a
+// Resolver type directly. The URL scheme selects the backend:
+//
+//	consul://consul.service:8500/nsqlookupd?tag=prod&dc=us-east&token=...
+//	etcd://etcd:2379/nsq/lookupd/
+//	srv://_nsqlookup._tcp.nsq.svc
+//	static://a:4161,b:4161
+//
+// When configuring more than one of these, for example to combine a static
+// fallback with a dynamic backend, separate the URLs with whitespace, not
+// commas:
+//
+//	static://a:4161,b:4161 consul://consul.service:8500/nsqlookupd
+//
+// Whitespace is used deliberately instead of a comma: the "static" scheme's
+// own address list is already comma-separated, so a comma-separated outer
+// list would be ambiguous about which commas delimit URLs and which
+// delimit addresses within one. If you've documented this configuration
+// value for your own users as "a comma-separated list of discovery URLs",
+// update that wording to "whitespace-separated" to match.
+package nsqlookup
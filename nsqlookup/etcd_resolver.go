@@ -0,0 +1,153 @@
+package nsqlookup
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// EtcdResolver is a Resolver implementation which discovers nsqlookupd
+// servers registered as keys under a prefix in etcd. nsqlookupd instances
+// are expected to register a key under Prefix whose value is their
+// "host:port" address, for example "/nsq/lookupd/10.0.0.1:4161".
+type EtcdResolver struct {
+	// Address of the etcd cluster to query, e.g. "http://localhost:2379".
+	Address string
+
+	// Prefix is the key prefix under which nsqlookupd servers are
+	// registered. If empty, "/nsq/lookupd/" is used instead.
+	Prefix string
+
+	// TLS is the TLS configuration used to connect to etcd, if the cluster
+	// requires it.
+	TLS *tls.Config
+
+	// Client is the HTTP client used to query etcd. If nil, a client using
+	// TLS is constructed instead.
+	Client *http.Client
+}
+
+type etcdNode struct {
+	Key   string
+	Value string
+	Nodes []etcdNode
+}
+
+type etcdGetResponse struct {
+	Node etcdNode
+}
+
+// Resolve queries etcd for the keys registered under e.Prefix and returns
+// their values as the list of nsqlookupd addresses.
+func (e *EtcdResolver) Resolve(ctx context.Context) ([]string, error) {
+	prefix := e.Prefix
+	if len(prefix) == 0 {
+		prefix = "/nsq/lookupd/"
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{}
+		if e.TLS != nil {
+			client.Transport = &http.Transport{TLSClientConfig: e.TLS}
+		}
+	}
+
+	url := fmt.Sprintf("%s/v2/keys%s?recursive=true", e.Address, prefix)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var response etcdGetResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	collectEtcdAddrs(response.Node, &addrs)
+	return addrs, nil
+}
+
+func collectEtcdAddrs(node etcdNode, addrs *[]string) {
+	if len(node.Nodes) == 0 {
+		if len(node.Value) != 0 {
+			*addrs = append(*addrs, node.Value)
+		}
+		return
+	}
+	for _, child := range node.Nodes {
+		collectEtcdAddrs(child, addrs)
+	}
+}
+
+// ZookeeperConn is the subset of a ZooKeeper client connection used by
+// ZookeeperResolver. It mirrors the Children and Get methods found on
+// *zk.Conn from github.com/samuel/go-zookeeper/zk; wrap that type in a thin
+// adapter to satisfy this interface, since its Stat return value is a
+// concrete type rather than interface{}.
+type ZookeeperConn interface {
+	Children(path string) ([]string, interface{}, error)
+	Get(path string) ([]byte, interface{}, error)
+}
+
+// ZookeeperResolver is a Resolver implementation which discovers nsqlookupd
+// servers registered as ephemeral znodes under a path in ZooKeeper.
+// nsqlookupd instances are expected to create a child znode under Path whose
+// data is their "host:port" address.
+type ZookeeperResolver struct {
+	// Address of the ZooKeeper cluster to query, e.g.
+	// "zk1:2181,zk2:2181,zk3:2181".
+	Address string
+
+	// Path is the znode path under which nsqlookupd servers register
+	// themselves. If empty, "/nsq/lookupd" is used instead.
+	Path string
+
+	// Conn is the ZooKeeper connection used to query the cluster. It must
+	// be set by the caller since establishing and maintaining a ZooKeeper
+	// session is the caller's responsibility.
+	Conn ZookeeperConn
+}
+
+// Resolve lists the children of z.Path and returns the data of each child
+// znode as the list of nsqlookupd addresses.
+func (z *ZookeeperResolver) Resolve(ctx context.Context) ([]string, error) {
+	path := z.Path
+	if len(path) == 0 {
+		path = "/nsq/lookupd"
+	}
+
+	children, _, err := z.Conn.Children(path)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(children))
+	for _, child := range children {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		data, _, err := z.Conn.Get(strings.TrimRight(path, "/") + "/" + child)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, string(data))
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,78 @@
+package nsqlookup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestResolveEtcd(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/keys/nsq/lookupd/" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		res.Write([]byte(`{
+			"node": {
+				"key": "/nsq/lookupd",
+				"dir": true,
+				"nodes": [
+					{"key": "/nsq/lookupd/127.0.0.1:4161", "value": "127.0.0.1:4161"},
+					{"key": "/nsq/lookupd/127.0.0.2:4161", "value": "127.0.0.2:4161"}
+				]
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	rslv := &EtcdResolver{Address: server.URL}
+
+	res, err := rslv.Resolve(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+
+	sort.Strings(res)
+	if !reflect.DeepEqual(res, []string{"127.0.0.1:4161", "127.0.0.2:4161"}) {
+		t.Error(res)
+	}
+}
+
+type fakeZookeeperConn struct {
+	children map[string][]string
+	data     map[string]string
+}
+
+func (f *fakeZookeeperConn) Children(path string) ([]string, interface{}, error) {
+	return f.children[path], nil, nil
+}
+
+func (f *fakeZookeeperConn) Get(path string) ([]byte, interface{}, error) {
+	return []byte(f.data[path]), nil, nil
+}
+
+func TestResolveZookeeper(t *testing.T) {
+	conn := &fakeZookeeperConn{
+		children: map[string][]string{
+			"/nsq/lookupd": {"A", "B"},
+		},
+		data: map[string]string{
+			"/nsq/lookupd/A": "127.0.0.1:4161",
+			"/nsq/lookupd/B": "127.0.0.2:4161",
+		},
+	}
+
+	rslv := &ZookeeperResolver{Conn: conn}
+
+	res, err := rslv.Resolve(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !reflect.DeepEqual(res, []string{"127.0.0.1:4161", "127.0.0.2:4161"}) {
+		t.Error(res)
+	}
+}
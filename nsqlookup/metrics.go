@@ -0,0 +1,151 @@
+package nsqlookup
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Tracer lets callers plug external tracing, such as OpenTelemetry spans,
+// around calls to Resolve. StartResolve is invoked before the wrapped
+// resolver runs and must return the context to use for the call (typically
+// one carrying a new span) along with a function to call with the
+// resulting error once Resolve returns.
+type Tracer interface {
+	StartResolve(ctx context.Context) (context.Context, func(error))
+}
+
+// TracerFunc allows ordinary functions to be used as a Tracer.
+type TracerFunc func(ctx context.Context) (context.Context, func(error))
+
+// StartResolve calls f(ctx).
+func (f TracerFunc) StartResolve(ctx context.Context) (context.Context, func(error)) {
+	return f(ctx)
+}
+
+// ObservedResolver wraps a Resolver, recording Prometheus metrics and,
+// optionally, tracing spans around every call to Resolve. It implements
+// prometheus.Collector so it can be registered with a prometheus.Registry
+// directly.
+type ObservedResolver struct {
+	// Resolver is the resolver being observed.
+	Resolver Resolver
+
+	// Tracer, if set, is invoked around every call to Resolve.
+	Tracer Tracer
+
+	resolveTotal   prometheus.Counter
+	resolveErrors  prometheus.Counter
+	resolveLatency prometheus.Histogram
+	cacheHits      prometheus.Counter
+	cacheMisses    prometheus.Counter
+	serverCount    prometheus.Gauge
+}
+
+// NewObservedResolver wraps r, labeling its metrics with backend, which
+// typically identifies the kind of resolver being observed (e.g. "consul",
+// "etcd", "dns"). If r is a *CachedResolver, its OnHit and OnMiss hooks are
+// wired up to the cache_hits_total and cache_misses_total counters.
+func NewObservedResolver(backend string, r Resolver) *ObservedResolver {
+	labels := prometheus.Labels{"backend": backend}
+
+	o := &ObservedResolver{
+		Resolver: r,
+
+		resolveTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "nsqlookup",
+			Subsystem:   "resolver",
+			Name:        "resolve_total",
+			Help:        "Number of calls made to Resolve.",
+			ConstLabels: labels,
+		}),
+		resolveErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "nsqlookup",
+			Subsystem:   "resolver",
+			Name:        "resolve_errors_total",
+			Help:        "Number of calls to Resolve that returned an error.",
+			ConstLabels: labels,
+		}),
+		resolveLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   "nsqlookup",
+			Subsystem:   "resolver",
+			Name:        "resolve_duration_seconds",
+			Help:        "Latency of calls to Resolve.",
+			ConstLabels: labels,
+		}),
+		cacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "nsqlookup",
+			Subsystem:   "resolver",
+			Name:        "cache_hits_total",
+			Help:        "Number of Resolve calls served from cache.",
+			ConstLabels: labels,
+		}),
+		cacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "nsqlookup",
+			Subsystem:   "resolver",
+			Name:        "cache_misses_total",
+			Help:        "Number of Resolve calls that waited on the upstream resolver, plus background refreshes.",
+			ConstLabels: labels,
+		}),
+		serverCount: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "nsqlookup",
+			Subsystem:   "resolver",
+			Name:        "server_count",
+			Help:        "Number of servers returned by the last successful Resolve.",
+			ConstLabels: labels,
+		}),
+	}
+
+	if cr, ok := r.(*CachedResolver); ok {
+		cr.OnHit = o.cacheHits.Inc
+		cr.OnMiss = o.cacheMisses.Inc
+	}
+
+	return o
+}
+
+// Resolve calls the wrapped resolver, recording metrics and, if a Tracer is
+// set, a tracing span around the call.
+func (o *ObservedResolver) Resolve(ctx context.Context) (addrs []string, err error) {
+	start := time.Now()
+
+	if o.Tracer != nil {
+		var end func(error)
+		ctx, end = o.Tracer.StartResolve(ctx)
+		defer func() { end(err) }()
+	}
+
+	addrs, err = o.Resolver.Resolve(ctx)
+
+	o.resolveTotal.Inc()
+	o.resolveLatency.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		o.resolveErrors.Inc()
+	} else {
+		o.serverCount.Set(float64(len(addrs)))
+	}
+
+	return addrs, err
+}
+
+// Describe implements prometheus.Collector.
+func (o *ObservedResolver) Describe(ch chan<- *prometheus.Desc) {
+	o.resolveTotal.Describe(ch)
+	o.resolveErrors.Describe(ch)
+	o.resolveLatency.Describe(ch)
+	o.cacheHits.Describe(ch)
+	o.cacheMisses.Describe(ch)
+	o.serverCount.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (o *ObservedResolver) Collect(ch chan<- prometheus.Metric) {
+	o.resolveTotal.Collect(ch)
+	o.resolveErrors.Collect(ch)
+	o.resolveLatency.Collect(ch)
+	o.cacheHits.Collect(ch)
+	o.cacheMisses.Collect(ch)
+	o.serverCount.Collect(ch)
+}
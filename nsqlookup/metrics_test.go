@@ -0,0 +1,107 @@
+package nsqlookup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObservedResolver(t *testing.T) {
+	fail := false
+
+	obs := NewObservedResolver("test", ResolverFunc(func(ctx context.Context) ([]string, error) {
+		if fail {
+			return nil, errors.New("boom")
+		}
+		return []string{"A", "B"}, nil
+	}))
+
+	if _, err := obs.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	fail = true
+	if _, err := obs.Resolve(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if n := testutil.ToFloat64(obs.resolveTotal); n != 2 {
+		t.Error("resolve_total:", n)
+	}
+	if n := testutil.ToFloat64(obs.resolveErrors); n != 1 {
+		t.Error("resolve_errors_total:", n)
+	}
+	if n := testutil.ToFloat64(obs.serverCount); n != 2 {
+		t.Error("server_count:", n)
+	}
+}
+
+func TestObservedResolverCacheHooks(t *testing.T) {
+	cached := &CachedResolver{
+		Resolver: ResolverFunc(func(ctx context.Context) ([]string, error) {
+			return []string{"A"}, nil
+		}),
+		Timeout: time.Hour,
+	}
+
+	obs := NewObservedResolver("test", cached)
+
+	for i := 0; i != 3; i++ {
+		if _, err := obs.Resolve(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := testutil.ToFloat64(obs.cacheMisses); n != 1 {
+		t.Error("cache_misses_total:", n)
+	}
+	if n := testutil.ToFloat64(obs.cacheHits); n != 2 {
+		t.Error("cache_hits_total:", n)
+	}
+}
+
+func TestObservedResolverCacheHooksCountCoalescedCallers(t *testing.T) {
+	block := make(chan struct{})
+
+	cached := &CachedResolver{
+		Resolver: ResolverFunc(func(ctx context.Context) ([]string, error) {
+			<-block
+			return []string{"A"}, nil
+		}),
+		Timeout: time.Hour,
+	}
+
+	obs := NewObservedResolver("test", cached)
+
+	const n = 10
+	var wg sync.WaitGroup
+	wg.Add(n)
+
+	for i := 0; i != n; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := obs.Resolve(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(block)
+	wg.Wait()
+
+	hits := testutil.ToFloat64(obs.cacheHits)
+	misses := testutil.ToFloat64(obs.cacheMisses)
+	total := testutil.ToFloat64(obs.resolveTotal)
+
+	if hits+misses != total {
+		t.Errorf("hits (%v) + misses (%v) = %v, want resolve_total %v", hits, misses, hits+misses, total)
+	}
+	if misses != n {
+		t.Errorf("expected every coalesced caller to count as a miss, got %v", misses)
+	}
+}
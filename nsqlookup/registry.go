@@ -0,0 +1,124 @@
+package nsqlookup
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ResolverFactory builds a Resolver from a URL whose scheme matches the name
+// it was registered under via RegisterResolverScheme.
+type ResolverFactory func(u *url.URL) (Resolver, error)
+
+var (
+	resolverRegistryMutex sync.RWMutex
+	resolverRegistry      = map[string]ResolverFactory{}
+)
+
+func init() {
+	RegisterResolverScheme("consul", newConsulResolverFromURL)
+	RegisterResolverScheme("etcd", newEtcdResolverFromURL)
+	RegisterResolverScheme("zk", newZookeeperResolverFromURL)
+	RegisterResolverScheme("srv", newDNSResolverFromURL)
+	RegisterResolverScheme("static", newStaticResolverFromURL)
+}
+
+// RegisterResolverScheme registers factory as the constructor used by
+// ResolverFromURL for URLs with the given scheme. Packages that implement
+// additional Resolver backends typically call this from an init function.
+func RegisterResolverScheme(scheme string, factory ResolverFactory) {
+	resolverRegistryMutex.Lock()
+	defer resolverRegistryMutex.Unlock()
+	resolverRegistry[scheme] = factory
+}
+
+// ResolverFromURL builds a Resolver from rawurl. The URL scheme selects
+// which backend is used, for example:
+//
+//	consul://consul.service:8500/nsqlookupd?tag=prod&dc=us-east&token=...
+//	etcd://etcd:2379/nsq/lookupd/
+//	srv://_nsqlookup._tcp.nsq.svc
+//	static://a:4161,b:4161
+//
+// Backends are registered with RegisterResolverScheme.
+func ResolverFromURL(rawurl string) (Resolver, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	resolverRegistryMutex.RLock()
+	factory, ok := resolverRegistry[u.Scheme]
+	resolverRegistryMutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("nsqlookup: no resolver registered for scheme %q", u.Scheme)
+	}
+
+	return factory(u)
+}
+
+// MultiResolverFromURLs builds a MultiResolver from a whitespace-separated
+// list of resolver URLs, each of which is parsed by ResolverFromURL. Fields
+// are split on whitespace rather than a comma because some schemes, such as
+// "static", already use a comma to separate addresses within a single URL,
+// e.g.:
+//
+//	static://a:4161,b:4161 consul://consul.service:8500/nsqlookupd
+func MultiResolverFromURLs(rawurls string) (Resolver, error) {
+	var resolvers []Resolver
+
+	for _, rawurl := range strings.Fields(rawurls) {
+		r, err := ResolverFromURL(rawurl)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, r)
+	}
+
+	return MultiResolver(resolvers...), nil
+}
+
+func newConsulResolverFromURL(u *url.URL) (Resolver, error) {
+	return &ConsulResolver{
+		Address:    "http://" + u.Host,
+		Service:    strings.Trim(u.Path, "/"),
+		Datacenter: u.Query().Get("dc"),
+		Tag:        u.Query().Get("tag"),
+		Token:      u.Query().Get("token"),
+	}, nil
+}
+
+func newEtcdResolverFromURL(u *url.URL) (Resolver, error) {
+	return &EtcdResolver{
+		Address: "http://" + u.Host,
+		Prefix:  u.Path,
+	}, nil
+}
+
+func newZookeeperResolverFromURL(u *url.URL) (Resolver, error) {
+	return nil, fmt.Errorf("nsqlookup: zk:// URLs cannot build a ZookeeperResolver on their own, construct one directly with a Conn")
+}
+
+func newDNSResolverFromURL(u *url.URL) (Resolver, error) {
+	name := u.Host + u.Path
+	return &DNSResolver{Name: name}, nil
+}
+
+func newStaticResolverFromURL(u *url.URL) (Resolver, error) {
+	raw := u.Opaque
+	if len(raw) == 0 {
+		raw = u.Host + u.Path
+	}
+
+	var servers Servers
+	for _, addr := range strings.Split(raw, ",") {
+		addr = strings.TrimSpace(addr)
+		if len(addr) != 0 {
+			servers = append(servers, addr)
+		}
+	}
+
+	return servers, nil
+}
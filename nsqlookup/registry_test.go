@@ -0,0 +1,90 @@
+package nsqlookup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolverFromURLStatic(t *testing.T) {
+	r, err := ResolverFromURL("static://a:4161,b:4161")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(r, Servers{"a:4161", "b:4161"}) {
+		t.Error(r)
+	}
+}
+
+func TestResolverFromURLConsul(t *testing.T) {
+	r, err := ResolverFromURL("consul://consul.service:8500/nsqlookupd?tag=prod&dc=us-east&token=s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, ok := r.(*ConsulResolver)
+	if !ok {
+		t.Fatalf("expected a *ConsulResolver, got %T", r)
+	}
+
+	if c.Address != "http://consul.service:8500" || c.Service != "nsqlookupd" || c.Tag != "prod" || c.Datacenter != "us-east" || c.Token != "s3cr3t" {
+		t.Error(c)
+	}
+}
+
+func TestResolverFromURLSRV(t *testing.T) {
+	r, err := ResolverFromURL("srv://_nsqlookup._tcp.nsq.svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, ok := r.(*DNSResolver)
+	if !ok {
+		t.Fatalf("expected a *DNSResolver, got %T", r)
+	}
+
+	if d.Name != "_nsqlookup._tcp.nsq.svc" {
+		t.Error(d.Name)
+	}
+}
+
+func TestResolverFromURLUnknownScheme(t *testing.T) {
+	if _, err := ResolverFromURL("bogus://whatever"); err == nil {
+		t.Error("expected an error for an unregistered scheme")
+	}
+}
+
+func TestMultiResolverFromURLs(t *testing.T) {
+	r, err := MultiResolverFromURLs("static://a:4161 static://b:4161")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.Resolve(nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(res) != 2 {
+		t.Error(res)
+	}
+}
+
+func TestMultiResolverFromURLsWithCommaSeparatedStaticAddrs(t *testing.T) {
+	// The "static" scheme's own comma-separated address list must survive
+	// being combined with another URL in a multi-URL list, which is why the
+	// outer list is whitespace-separated rather than comma-separated.
+	r, err := MultiResolverFromURLs("static://a:4161,b:4161 static://c:4161")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.Resolve(nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !reflect.DeepEqual(res, []string{"a:4161", "b:4161", "c:4161"}) {
+		t.Error(res)
+	}
+}
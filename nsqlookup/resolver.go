@@ -0,0 +1,493 @@
+package nsqlookup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// consulWatchMinBackoff and consulWatchMaxBackoff bound the delay between
+// retries in ConsulResolver.Watch after a failed Resolve, so a down or
+// unreachable consul agent doesn't get hammered by a tight retry loop.
+const (
+	consulWatchMinBackoff = time.Second
+	consulWatchMaxBackoff = 30 * time.Second
+)
+
+// The Resolver interface is implemented by types that know how to discover
+// the addresses of the nsqlookupd servers a nsqd or consumer program should
+// talk to.
+type Resolver interface {
+	// Resolve returns the list of addresses at which nsqlookupd servers can
+	// be reached.
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// ResolverFunc makes it possible to use regular functions as resolvers.
+type ResolverFunc func(ctx context.Context) ([]string, error)
+
+// Resolve calls f(ctx).
+func (f ResolverFunc) Resolve(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// Servers is a resolver implementation which resolves to a static list of
+// server addresses.
+type Servers []string
+
+// Resolve returns the list of addresses in s, or an error if ctx has already
+// been canceled.
+func (s Servers) Resolve(ctx context.Context) ([]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	return []string(s), nil
+}
+
+// CachedResolver is a Resolver implementation which caches the result of
+// another resolver for a configurable amount of time, so repeated calls to
+// Resolve don't all hit the upstream resolver. Concurrent cache misses are
+// coalesced into a single upstream call.
+type CachedResolver struct {
+	// Resolver is the resolver whose results are being cached.
+	Resolver Resolver
+
+	// Timeout is the amount of time for which a resolved server list stays
+	// valid before the resolver is queried again.
+	Timeout time.Duration
+
+	// NegativeTimeout is the amount of time for which an error returned by
+	// Resolver is cached, so a flapping upstream doesn't get hit by every
+	// concurrent caller. If zero, errors are never cached.
+	NegativeTimeout time.Duration
+
+	// StaleTimeout is the amount of time, counted from the last successful
+	// upstream call, for which Resolve keeps returning that server list,
+	// without an error, once Timeout has elapsed, whether or not the
+	// upstream resolver is failing. While stale results are being served, a
+	// refresh is kicked off in the background so the cache catches up as
+	// soon as the upstream answers.
+	// If zero, failures are always returned to the caller.
+	StaleTimeout time.Duration
+
+	// OnHit and OnMiss, if set, are called synchronously for
+	// instrumentation, e.g. by ObservedResolver. OnHit is called whenever
+	// Resolve returns a cached result, including a stale one. OnMiss is
+	// called whenever Resolve waits on an upstream call, whether it started
+	// that call or joined one already in flight, and also when serving a
+	// stale result starts a background refresh.
+	OnHit  func()
+	OnMiss func()
+
+	mutex       sync.Mutex
+	cache       []string
+	err         error
+	lastUpdate  time.Time
+	lastGood    []string
+	lastSuccess time.Time
+	call        *cachedResolverCall
+}
+
+// cachedResolverCall represents an upstream resolve in flight, shared by
+// every caller that observes a cache miss while it is running. done is
+// closed once addrs/err are populated, so waiters can select on it
+// alongside their own context instead of blocking unconditionally on
+// whichever context triggered the call.
+type cachedResolverCall struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+func newCachedResolverCall() *cachedResolverCall {
+	return &cachedResolverCall{done: make(chan struct{})}
+}
+
+// Resolve returns the cached server list, refreshing it by calling the
+// underlying resolver if it is older than c.Timeout.
+func (c *CachedResolver) Resolve(ctx context.Context) ([]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	c.mutex.Lock()
+
+	now := time.Now()
+
+	if c.freshLocked(now) {
+		addrs, err := c.cache, c.err
+		c.mutex.Unlock()
+		c.hit()
+		return addrs, err
+	}
+
+	if c.StaleTimeout > 0 && c.lastGood != nil && now.Sub(c.lastSuccess) < c.StaleTimeout {
+		addrs := c.lastGood
+		c.refreshInBackgroundLocked()
+		c.mutex.Unlock()
+		c.hit()
+		return addrs, nil
+	}
+
+	// The upstream call, whether started by this caller or one already in
+	// flight, always runs on a context detached from any single caller (see
+	// refreshInBackgroundLocked). Otherwise one caller's context being
+	// canceled mid-flight would poison the shared result for every other
+	// caller waiting on the same call, including ones with a perfectly live
+	// context. Each caller still races the shared call against its own
+	// context below, so its own cancellation is honored.
+	call := c.call
+	if call == nil {
+		call = newCachedResolverCall()
+		c.call = call
+		c.miss()
+
+		go func() {
+			addrs, err := c.Resolver.Resolve(context.Background())
+			c.storeLocked(addrs, err)
+			call.addrs, call.err = addrs, err
+			close(call.done)
+		}()
+	} else {
+		c.miss()
+	}
+
+	c.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.addrs, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *CachedResolver) hit() {
+	if c.OnHit != nil {
+		c.OnHit()
+	}
+}
+
+func (c *CachedResolver) miss() {
+	if c.OnMiss != nil {
+		c.OnMiss()
+	}
+}
+
+// freshLocked reports whether the cached result can be returned as-is,
+// i.e. it is a successful result younger than Timeout, or a cached error
+// younger than NegativeTimeout. c.mutex must be held.
+func (c *CachedResolver) freshLocked(now time.Time) bool {
+	if c.lastUpdate.IsZero() {
+		return false
+	}
+	if c.err == nil {
+		return now.Sub(c.lastUpdate) <= c.Timeout
+	}
+	return c.NegativeTimeout > 0 && now.Sub(c.lastUpdate) <= c.NegativeTimeout
+}
+
+// refreshInBackgroundLocked starts an upstream resolve detached from any
+// caller's context, unless one is already in flight. c.mutex must be held.
+func (c *CachedResolver) refreshInBackgroundLocked() {
+	if c.call != nil {
+		return
+	}
+
+	call := newCachedResolverCall()
+	c.call = call
+	c.miss()
+
+	go func() {
+		addrs, err := c.Resolver.Resolve(context.Background())
+		c.storeLocked(addrs, err)
+		call.addrs, call.err = addrs, err
+		close(call.done)
+	}()
+}
+
+// storeLocked records the result of an upstream resolve and clears the
+// in-flight call marker.
+func (c *CachedResolver) storeLocked(addrs []string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.cache, c.err = addrs, err
+	c.lastUpdate = time.Now()
+	if err == nil {
+		c.lastGood = addrs
+		c.lastSuccess = c.lastUpdate
+	}
+	c.call = nil
+}
+
+// MultiResolver merges the results of resolvers into a single list of
+// server addresses. The resolvers are queried concurrently.
+func MultiResolver(resolvers ...Resolver) Resolver {
+	return ResolverFunc(func(ctx context.Context) (addrs []string, err error) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		results := make([][]string, len(resolvers))
+		errors := make([]error, len(resolvers))
+
+		wg := sync.WaitGroup{}
+		wg.Add(len(resolvers))
+
+		for i, r := range resolvers {
+			go func(i int, r Resolver) {
+				defer wg.Done()
+				results[i], errors[i] = r.Resolve(ctx)
+			}(i, r)
+		}
+
+		wg.Wait()
+
+		for _, e := range errors {
+			if e != nil {
+				err = e
+			}
+		}
+
+		for _, res := range results {
+			addrs = append(addrs, res...)
+		}
+
+		return
+	})
+}
+
+// ConsulResolver is a Resolver implementation which fetches the list of
+// nsqlookupd addresses from the health checks of a service registered in
+// Consul. It transparently uses Consul blocking queries so that repeated
+// calls to Resolve return promptly once membership actually changes instead
+// of polling as fast as the caller allows.
+type ConsulResolver struct {
+	// Address of the consul agent to query, e.g. "http://localhost:8500".
+	Address string
+
+	// Service is the name of the service representing the nsqlookupd
+	// servers. If empty, "nsqlookupd" is used instead.
+	Service string
+
+	// Datacenter restricts the query to a specific consul datacenter, if
+	// set.
+	Datacenter string
+
+	// Tag restricts the query to nodes registered with this tag, if set.
+	Tag string
+
+	// Token is the ACL token sent with the request, if set.
+	Token string
+
+	// WaitTime bounds how long a blocking query may be held open by the
+	// consul agent. If zero, 1 minute is used instead.
+	WaitTime time.Duration
+
+	// WatchMinBackoff and WatchMaxBackoff bound the jittered backoff that
+	// Watch sleeps for between retries after a failed Resolve. If zero,
+	// consulWatchMinBackoff and consulWatchMaxBackoff are used instead.
+	WatchMinBackoff time.Duration
+	WatchMaxBackoff time.Duration
+
+	// Client is the HTTP client used to query consul. If nil,
+	// http.DefaultClient is used instead.
+	Client *http.Client
+
+	mutex sync.Mutex
+	index string
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Node    string
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+	Checks []struct {
+		Status string
+	}
+}
+
+// Resolve queries the consul agent for the list of healthy nodes registered
+// for c.Service and returns their addresses. Nodes reporting a failing
+// health check are filtered out.
+func (c *ConsulResolver) Resolve(ctx context.Context) ([]string, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	c.mutex.Lock()
+	index := c.index
+	c.mutex.Unlock()
+
+	req, err := http.NewRequest("GET", c.queryURL(index), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if len(c.Token) != 0 {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.index = res.Header.Get("X-Consul-Index")
+	c.mutex.Unlock()
+
+	addrs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !consulChecksPassing(entry.Checks) {
+			continue
+		}
+
+		addr := entry.Service.Address
+		if len(addr) == 0 {
+			addr = entry.Node.Address
+		}
+		addrs = append(addrs, fmt.Sprintf("%s:%d", addr, entry.Service.Port))
+	}
+
+	return addrs, nil
+}
+
+// Watch starts polling consul via blocking queries and returns a channel on
+// which the server list is sent every time it changes. The channel is
+// closed when ctx is canceled.
+func (c *ConsulResolver) Watch(ctx context.Context) <-chan []string {
+	out := make(chan []string)
+
+	minBackoff := c.WatchMinBackoff
+	if minBackoff <= 0 {
+		minBackoff = consulWatchMinBackoff
+	}
+
+	maxBackoff := c.WatchMaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = consulWatchMaxBackoff
+	}
+
+	go func() {
+		defer close(out)
+
+		var last []string
+		backoff := minBackoff
+
+		for {
+			addrs, err := c.Resolve(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				select {
+				case <-time.After(jitter(backoff)):
+				case <-ctx.Done():
+					return
+				}
+
+				if backoff *= 2; backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+				continue
+			}
+
+			backoff = minBackoff
+
+			if !reflect.DeepEqual(addrs, last) {
+				last = addrs
+				select {
+				case out <- addrs:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
+	}()
+
+	return out
+}
+
+// jitter returns a duration chosen uniformly at random from [d/2, d], so
+// that concurrent retries don't all land on the consul agent at once.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half+1)))
+}
+
+func (c *ConsulResolver) queryURL(index string) string {
+	service := c.Service
+	if len(service) == 0 {
+		service = "nsqlookupd"
+	}
+
+	waitTime := c.WaitTime
+	if waitTime == 0 {
+		waitTime = time.Minute
+	}
+
+	query := url.Values{}
+	if len(c.Datacenter) != 0 {
+		query.Set("dc", c.Datacenter)
+	}
+	if len(c.Tag) != 0 {
+		query.Set("tag", c.Tag)
+	}
+	if len(index) != 0 {
+		query.Set("index", index)
+		query.Set("wait", waitTime.String())
+	}
+
+	u := fmt.Sprintf("%s/v1/health/service/%s", c.Address, service)
+	if encoded := query.Encode(); len(encoded) != 0 {
+		u += "?" + encoded
+	}
+
+	return u
+}
+
+func consulChecksPassing(checks []struct{ Status string }) bool {
+	for _, check := range checks {
+		if check.Status != "passing" {
+			return false
+		}
+	}
+	return true
+}
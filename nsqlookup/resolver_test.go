@@ -3,11 +3,14 @@ package nsqlookup
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -107,6 +110,159 @@ func TestResolveCached(t *testing.T) {
 	}
 }
 
+func TestResolveCachedConcurrentMissesCoalesce(t *testing.T) {
+	var misses int32
+	block := make(chan struct{})
+
+	rslv := &CachedResolver{
+		Resolver: ResolverFunc(func(ctx context.Context) ([]string, error) {
+			atomic.AddInt32(&misses, 1)
+			<-block
+			return Servers{"A", "B"}.Resolve(ctx)
+		}),
+		Timeout: time.Minute,
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(10)
+
+	for i := 0; i != 10; i++ {
+		go func() {
+			defer wg.Done()
+			res, err := rslv.Resolve(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(res, []string{"A", "B"}) {
+				t.Error(res)
+			}
+		}()
+	}
+
+	// Give every goroutine a chance to observe the cache miss before
+	// letting the upstream call complete.
+	time.Sleep(20 * time.Millisecond)
+	close(block)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&misses); n != 1 {
+		t.Error("expected a single upstream call, got", n)
+	}
+}
+
+func TestResolveCachedJoiningCallerUsesOwnContext(t *testing.T) {
+	leaderStarted := make(chan struct{})
+	block := make(chan struct{})
+
+	rslv := &CachedResolver{
+		Resolver: ResolverFunc(func(ctx context.Context) ([]string, error) {
+			close(leaderStarted)
+			<-block
+			return Servers{"A", "B"}.Resolve(ctx)
+		}),
+		Timeout: time.Minute,
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		rslv.Resolve(leaderCtx)
+	}()
+
+	<-leaderStarted
+
+	followerDone := make(chan struct{})
+	var followerRes []string
+	var followerErr error
+	go func() {
+		defer close(followerDone)
+		followerRes, followerErr = rslv.Resolve(context.Background())
+	}()
+
+	// Give the follower a chance to join the in-flight call before it
+	// completes.
+	time.Sleep(20 * time.Millisecond)
+
+	// Cancel the leader's context while the shared upstream call is still
+	// in flight; the follower's own context is never touched.
+	cancelLeader()
+	close(block)
+
+	<-leaderDone
+	<-followerDone
+
+	if followerErr != nil {
+		t.Error("a joining caller with a live context should not observe the leader's cancellation:", followerErr)
+	}
+	if !reflect.DeepEqual(followerRes, []string{"A", "B"}) {
+		t.Error(followerRes)
+	}
+}
+
+func TestResolveCachedNegativeTimeout(t *testing.T) {
+	var misses int32
+
+	rslv := &CachedResolver{
+		Resolver: ResolverFunc(func(ctx context.Context) ([]string, error) {
+			atomic.AddInt32(&misses, 1)
+			return nil, errors.New("upstream unavailable")
+		}),
+		Timeout:         time.Minute,
+		NegativeTimeout: 20 * time.Millisecond,
+	}
+
+	for i := 0; i != 5; i++ {
+		if _, err := rslv.Resolve(context.Background()); err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	if n := atomic.LoadInt32(&misses); n != 1 {
+		t.Error("expected the error to be cached, got", n, "upstream calls")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, err := rslv.Resolve(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+	if n := atomic.LoadInt32(&misses); n != 2 {
+		t.Error("expected the cached error to expire, got", n, "upstream calls")
+	}
+}
+
+func TestResolveCachedStaleTimeout(t *testing.T) {
+	var fail int32
+
+	rslv := &CachedResolver{
+		Resolver: ResolverFunc(func(ctx context.Context) ([]string, error) {
+			if atomic.LoadInt32(&fail) != 0 {
+				return nil, errors.New("upstream unavailable")
+			}
+			return Servers{"A", "B"}.Resolve(ctx)
+		}),
+		Timeout:      10 * time.Millisecond,
+		StaleTimeout: time.Minute,
+	}
+
+	if res, err := rslv.Resolve(context.Background()); err != nil || !reflect.DeepEqual(res, []string{"A", "B"}) {
+		t.Fatal(res, err)
+	}
+
+	atomic.StoreInt32(&fail, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	res, err := rslv.Resolve(context.Background())
+	if err != nil {
+		t.Error("expected stale results instead of an error, got", err)
+	}
+	if !reflect.DeepEqual(res, []string{"A", "B"}) {
+		t.Error(res)
+	}
+}
+
 func TestResolveConsul(t *testing.T) {
 	type ServiceResultNode struct {
 		Node    string
@@ -189,6 +345,188 @@ func TestResolveConsul(t *testing.T) {
 	}
 }
 
+func TestResolveConsulFiltersFailingChecks(t *testing.T) {
+	type Check struct {
+		Status string
+	}
+
+	type ServiceResultNode struct {
+		Node    string
+		Address string
+	}
+
+	type ServiceResultService struct {
+		Address string
+		Port    int
+	}
+
+	type ServiceResult struct {
+		Node    ServiceResultNode
+		Service ServiceResultService
+		Checks  []Check
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode([]ServiceResult{
+			{
+				Node:    ServiceResultNode{Node: "A", Address: "127.0.0.1"},
+				Service: ServiceResultService{Port: 4161},
+				Checks:  []Check{{Status: "passing"}},
+			},
+			{
+				Node:    ServiceResultNode{Node: "B", Address: "127.0.0.2"},
+				Service: ServiceResultService{Port: 4161},
+				Checks:  []Check{{Status: "passing"}, {Status: "critical"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	rslv := &ConsulResolver{Address: server.URL}
+
+	res, err := rslv.Resolve(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(res, []string{"127.0.0.1:4161"}) {
+		t.Error(res)
+	}
+}
+
+func TestResolveConsulBlockingQuery(t *testing.T) {
+	var requests []*http.Request
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		res.Header().Set("X-Consul-Index", "42")
+		json.NewEncoder(res).Encode([]struct{}{})
+	}))
+	defer server.Close()
+
+	rslv := &ConsulResolver{Address: server.URL, Datacenter: "dc1", Tag: "prod"}
+
+	if _, err := rslv.Resolve(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if _, err := rslv.Resolve(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	if requests[0].URL.Query().Get("index") != "" {
+		t.Error("first request should not carry an index:", requests[0].URL.RawQuery)
+	}
+	if requests[1].URL.Query().Get("index") != "42" {
+		t.Error("second request should block on the last known index:", requests[1].URL.RawQuery)
+	}
+	if requests[1].URL.Query().Get("wait") == "" {
+		t.Error("second request should set a wait duration:", requests[1].URL.RawQuery)
+	}
+	if requests[0].URL.Query().Get("dc") != "dc1" || requests[0].URL.Query().Get("tag") != "prod" {
+		t.Error("datacenter and tag should be forwarded:", requests[0].URL.RawQuery)
+	}
+}
+
+func TestConsulResolverWatch(t *testing.T) {
+	type Check struct {
+		Status string
+	}
+
+	type ServiceResultNode struct {
+		Node    string
+		Address string
+	}
+
+	type ServiceResultService struct {
+		Address string
+		Port    int
+	}
+
+	type ServiceResult struct {
+		Node    ServiceResultNode
+		Service ServiceResultService
+		Checks  []Check
+	}
+
+	node := func(addr string) ServiceResult {
+		return ServiceResult{
+			Node:    ServiceResultNode{Node: addr, Address: addr},
+			Service: ServiceResultService{Address: addr, Port: 4161},
+			Checks:  []Check{{Status: "passing"}},
+		}
+	}
+
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch n := atomic.AddInt32(&requests, 1); {
+		case n == 1:
+			// First poll: initial server list, which Watch must emit.
+			json.NewEncoder(res).Encode([]ServiceResult{node("127.0.0.1")})
+		case n == 2:
+			// Second poll: unchanged, Watch must not emit again.
+			json.NewEncoder(res).Encode([]ServiceResult{node("127.0.0.1")})
+		case n == 3:
+			// Third poll: fails, Watch must back off and retry rather than
+			// giving up.
+			http.Error(res, "boom", http.StatusInternalServerError)
+		default:
+			// Fourth poll onwards: changed server list, which Watch must
+			// emit once recovered.
+			json.NewEncoder(res).Encode([]ServiceResult{node("127.0.0.1"), node("127.0.0.2")})
+		}
+	}))
+	defer server.Close()
+
+	rslv := &ConsulResolver{
+		Address:         server.URL,
+		WatchMinBackoff: time.Millisecond,
+		WatchMaxBackoff: 5 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watch := rslv.Watch(ctx)
+
+	select {
+	case addrs := <-watch:
+		if !reflect.DeepEqual(addrs, []string{"127.0.0.1:4161"}) {
+			t.Fatal("unexpected initial server list:", addrs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the initial server list")
+	}
+
+	select {
+	case addrs := <-watch:
+		t.Fatal("expected no emission for an unchanged server list, got", addrs)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	select {
+	case addrs := <-watch:
+		if !reflect.DeepEqual(addrs, []string{"127.0.0.1:4161", "127.0.0.2:4161"}) {
+			t.Fatal("unexpected server list after recovering from an error:", addrs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the server list to recover after a backoff/retry")
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-watch:
+		if ok {
+			t.Fatal("expected the channel to be closed after the context was canceled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the channel to close")
+	}
+}
+
 func TestResolveMulti(t *testing.T) {
 	rslv := MultiResolver(
 		Servers{},